@@ -16,35 +16,60 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"compress/gzip"
 	"context"
 	_ "embed"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/carlmjohnson/requests"
 	"github.com/linkedin/goavro"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc/status"
 )
 
 // Cloud Run Job Configuration
 type JobConfig struct {
-	TaskNum         string
-	AttemptNum      string
-	BucketMountPath string
-	ExportDate      time.Time
-	PubSubProjectID string
-	PubSubTopicID   string
-	APIKey          string
-	OutputPath      string
-	ExportTypes     []string
+	TaskNum                string
+	AttemptNum             string
+	BucketMountPath        string
+	ExportDate             time.Time
+	PubSubProjectID        string
+	PubSubTopicID          string
+	APIKey                 string
+	OutputPath             string
+	ExportTypes            []string
+	Publisher              PublisherConfig
+	AvroEncoding           AvroEncoding
+	SchemaRegistryURL      string
+	SchemaRegistrySubject  string
+	SchemaRegistryVersion  string
+	MaxParallelExportTypes int
+}
+
+// Pub/Sub Publisher Configuration, applied to every Topic's PublishSettings
+type PublisherConfig struct {
+	MaxOutstandingMessages int
+	MaxOutstandingBytes    int
+	BatchMaxMessages       int
+	BatchMaxBytes          int
+	BatchDelay             time.Duration
+	NumGoroutines          int
+	OrderingKeyField       string
 }
 
 //go:embed tmdb-trigger-topic-schema.json
@@ -118,8 +143,335 @@ func NewJobConfig() JobConfig {
 			"keyword",
 			"production_company",
 		},
+		Publisher:              NewPublisherConfig(),
+		AvroEncoding:           ParseAvroEncoding(os.Getenv("AVRO_ENCODING")),
+		SchemaRegistryURL:      os.Getenv("SCHEMA_REGISTRY_URL"),
+		SchemaRegistrySubject:  os.Getenv("SCHEMA_REGISTRY_SUBJECT"),
+		SchemaRegistryVersion:  defaultString(os.Getenv("SCHEMA_REGISTRY_VERSION"), "latest"),
+		MaxParallelExportTypes: getEnvInt("MAX_PARALLEL_EXPORT_TYPES", 3),
+	}
+
+}
+
+//---------------------------------------------------------------------------------------
+
+// Get the given String, falling back to the provided default when empty
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+//---------------------------------------------------------------------------------------
+
+// Get a New Publisher Configuration from Environment Variables, falling back to the
+// Pub/Sub client library defaults when a given variable is not set
+func NewPublisherConfig() PublisherConfig {
+
+	return PublisherConfig{
+		MaxOutstandingMessages: getEnvInt("PUBSUB_MAX_OUTSTANDING_MESSAGES", 1000),
+		MaxOutstandingBytes:    getEnvInt("PUBSUB_MAX_OUTSTANDING_BYTES", 1e9),
+		BatchMaxMessages:       getEnvInt("PUBSUB_BATCH_MAX_MESSAGES", 100),
+		BatchMaxBytes:          getEnvInt("PUBSUB_BATCH_MAX_BYTES", 1e6),
+		BatchDelay:             time.Duration(getEnvInt("PUBSUB_BATCH_DELAY_MS", 10)) * time.Millisecond,
+		NumGoroutines:          getEnvInt("PUBSUB_NUM_GOROUTINES", 25),
+		OrderingKeyField:       os.Getenv("PUBSUB_ORDERING_KEY_FIELD"),
+	}
+
+}
+
+//---------------------------------------------------------------------------------------
+
+// Get an Integer Environment Variable, falling back to the given default when unset or invalid
+func getEnvInt(key string, fallback int) int {
+
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value == 0 {
+		return fallback
+	}
+
+	return value
+}
+
+//---------------------------------------------------------------------------------------
+
+// AvroEncoding selects between Pub/Sub's BINARY and JSON AVRO wire encodings
+type AvroEncoding int
+
+const (
+	AvroEncodingBinary AvroEncoding = iota
+	AvroEncodingJSON
+)
+
+// ParseAvroEncoding parses the AVRO_ENCODING environment variable, defaulting to BINARY
+func ParseAvroEncoding(value string) AvroEncoding {
+	if strings.EqualFold(value, "JSON") {
+		return AvroEncodingJSON
+	}
+	return AvroEncodingBinary
+}
+
+//---------------------------------------------------------------------------------------
+
+// SchemaRegistrySchema mirrors a Confluent-compatible /subjects/{name}/versions/{version} response
+type SchemaRegistrySchema struct {
+	ID     int    `json:"id"`
+	Schema string `json:"schema"`
+}
+
+// cachedSchema pairs a resolved AVRO Codec with its Schema Registry ID
+type cachedSchema struct {
+	codec *goavro.Codec
+	id    int
+}
+
+// schemaRegistryCache caches resolved Codecs by "<subject>/<version>" so repeated exports
+// within the same Task don't refetch the schema from the Registry
+var schemaRegistryCache sync.Map
+
+// GetSchemaRegistryCodec fetches and caches an AVRO Codec by subject+version from a Confluent-
+// compatible Schema Registry
+func GetSchemaRegistryCodec(ctx context.Context, registryURL, subject, version string) (*goavro.Codec, int, error) {
+
+	cacheKey := subject + "/" + version
+	if cached, ok := schemaRegistryCache.Load(cacheKey); ok {
+		schema := cached.(*cachedSchema)
+		return schema.codec, schema.id, nil
+	}
+
+	var schemaResp SchemaRegistrySchema
+	err := requests.
+		URL(registryURL).
+		Pathf("/subjects/%s/versions/%s", subject, version).
+		ToJSON(&schemaResp).
+		Fetch(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to Fetch Schema from Registry: %w", err)
+	}
+
+	codec, err := goavro.NewCodec(schemaResp.Schema)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to Create AVRO Codec from Registry Schema: %w", err)
+	}
+
+	schemaRegistryCache.Store(cacheKey, &cachedSchema{codec: codec, id: schemaResp.ID})
+
+	return codec, schemaResp.ID, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// avroEncoder produces Pub/Sub message payloads per the configured AvroEncoding, applying
+// Confluent-compatible magic-byte + schema-ID framing when the Codec came from a Schema Registry
+type avroEncoder struct {
+	codec    *goavro.Codec
+	encoding AvroEncoding
+	schemaID int
+}
+
+// Encode converts the given datum record into a Pub/Sub message payload and the Attributes
+// Pub/Sub's native Schema Registry integration expects
+func (e *avroEncoder) Encode(datum map[string]interface{}) ([]byte, map[string]string, error) {
+
+	if e.encoding == AvroEncodingJSON {
+		payload, err := e.codec.TextualFromNative(nil, datum)
+		if err != nil {
+			return nil, nil, err
+		}
+		return payload, map[string]string{"googclient_schemaencoding": "JSON"}, nil
+	}
+
+	payload, err := e.codec.BinaryFromNative(nil, datum)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attrs := map[string]string{"googclient_schemaencoding": "BINARY"}
+	if e.schemaID != 0 {
+		payload = append(confluentMagicByteFraming(e.schemaID), payload...)
+		attrs["googclient_schemarevisionid"] = strconv.Itoa(e.schemaID)
+	}
+
+	return payload, attrs, nil
+}
+
+// confluentMagicByteFraming builds the 5-byte magic-byte + big-endian schema-ID prefix that
+// Confluent-compatible consumers (Kafka Connect, BigQuery subscriptions) expect ahead of a
+// binary AVRO payload
+func confluentMagicByteFraming(schemaID int) []byte {
+	framing := make([]byte, 5)
+	binary.BigEndian.PutUint32(framing[1:], uint32(schemaID))
+	return framing
+}
+
+//---------------------------------------------------------------------------------------
+
+// Apply the Publisher Configuration to the given Pub/Sub Topic
+func (config *JobConfig) ApplyPublisherConfig(psTopic *pubsub.Topic) {
+
+	psTopic.PublishSettings = pubsub.PublishSettings{
+		DelayThreshold: config.Publisher.BatchDelay,
+		CountThreshold: config.Publisher.BatchMaxMessages,
+		ByteThreshold:  config.Publisher.BatchMaxBytes,
+		NumGoroutines:  config.Publisher.NumGoroutines,
+		FlowControlSettings: pubsub.FlowControlSettings{
+			MaxOutstandingMessages: config.Publisher.MaxOutstandingMessages,
+			MaxOutstandingBytes:    config.Publisher.MaxOutstandingBytes,
+			LimitExceededBehavior:  pubsub.FlowControlBlock,
+		},
+	}
+
+	if config.Publisher.OrderingKeyField != "" {
+		psTopic.EnableMessageOrdering = true
+	}
+
+}
+
+// orderingKeyFromRecord extracts the configured Ordering Key Field's value from the Datum
+// Record as a string, returning "" (no ordering key) when the field is absent or empty
+func orderingKeyFromRecord(field string, record map[string]interface{}) string {
+	value, ok := record[field]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// orderingKeyShard deterministically maps an Ordering Key to one of numShards Worker
+// shards, so every Message for that key is always published from the same Worker and
+// therefore in Publish call order
+func orderingKeyShard(orderingKey string, numShards int) int {
+	if numShards <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(orderingKey))
+	return int(h.Sum32() % uint32(numShards))
+}
+
+//---------------------------------------------------------------------------------------
+
+// Publish Summary of a single Export Type, logged per type and aggregated, error code
+// counts included, into the final Backfill log line
+type PublishSummary struct {
+	MessageCount    int            `json:"message_count"`
+	FailureCount    int            `json:"failure_count"`
+	ErrorCodeCounts map[string]int `json:"error_code_counts,omitempty"`
+}
+
+//---------------------------------------------------------------------------------------
+
+// lineResult pairs a Publish Result with the export line number it came from, so the
+// Checkpoint can track which lines were actually confirmed rather than just the count
+type lineResult struct {
+	lineNum     int
+	result      *pubsub.PublishResult
+	orderingKey string
+}
+
+// ackTracker advances the highest contiguously-acked line number as out-of-order Publish
+// confirmations arrive, so a Checkpoint never records a line whose predecessor is still
+// unconfirmed (and therefore at risk of being skipped on resume)
+type ackTracker struct {
+	mu      sync.Mutex
+	next    int
+	pending map[int]bool
+}
+
+// newAckTracker starts tracking immediately after the given resume line
+func newAckTracker(resumeFrom int) *ackTracker {
+	return &ackTracker{next: resumeFrom + 1, pending: make(map[int]bool)}
+}
+
+// ack records the given line as published and returns the new contiguous watermark, or 0
+// if the watermark did not advance (the line arrived ahead of one that is still pending)
+func (a *ackTracker) ack(line int) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pending[line] = true
+	advanced := 0
+	for a.pending[a.next] {
+		delete(a.pending, a.next)
+		advanced = a.next
+		a.next++
 	}
+	return advanced
+}
 
+// watermark returns the highest contiguously-acked line so far
+func (a *ackTracker) watermark() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.next - 1
+}
+
+// checkpointFlushLines bounds how often the Checkpoint is rewritten while an Export Type
+// streams, so a Cloud Run preemption mid-export loses at most this many already-published
+// lines rather than the whole Export Type
+const checkpointFlushLines = 500
+
+// Await the given line-tagged Pub/Sub Publish Results concurrently, bounded by the
+// configured number of goroutines, aggregating failures by their gRPC status code while
+// advancing and periodically persisting the highest contiguously-acked line. When Message
+// Ordering is enabled, a failed Publish pauses its Ordering Key until ResumePublish is
+// called, so every failure resumes the key it belongs to
+func (config *JobConfig) AwaitPublishResults(ctx context.Context, psTopic *pubsub.Topic, exportType string, resumeFrom int, lineResults []lineResult, concurrency int) PublishSummary {
+
+	var summary = PublishSummary{MessageCount: len(lineResults)}
+	var mu sync.Mutex
+	tracker := newAckTracker(resumeFrom)
+	lastCheckpoint := resumeFrom
+
+	flushCheckpoint := func(line int, force bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if line <= lastCheckpoint || (!force && line-lastCheckpoint < checkpointFlushLines) {
+			return
+		}
+		lastCheckpoint = line
+		if err := config.writeCheckpoint(exportType, line); err != nil {
+			log.Printf("....Failed to Write Checkpoint for %s: %v", exportType, err)
+		}
+	}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(concurrency)
+
+	for _, lr := range lineResults {
+		lr := lr
+		group.Go(func() error {
+			_, err := lr.result.Get(groupCtx)
+			if err != nil {
+				if lr.orderingKey != "" {
+					psTopic.ResumePublish(lr.orderingKey)
+				}
+				mu.Lock()
+				summary.FailureCount++
+				if summary.ErrorCodeCounts == nil {
+					summary.ErrorCodeCounts = make(map[string]int)
+				}
+				summary.ErrorCodeCounts[status.Code(err).String()]++
+				mu.Unlock()
+				return nil
+			}
+
+			if advanced := tracker.ack(lr.lineNum); advanced > 0 {
+				flushCheckpoint(advanced, false)
+			}
+			return nil
+		})
+	}
+
+	// Errors are aggregated above rather than propagated, so this can never fail
+	_ = group.Wait()
+
+	// Always persist whatever contiguous watermark was reached, even short of a full
+	// checkpointFlushLines increment, so a cancelled/preempted Attempt still resumes forward
+	flushCheckpoint(tracker.watermark(), true)
+
+	return summary
 }
 
 //---------------------------------------------------------------------------------------
@@ -151,104 +503,304 @@ func (config *JobConfig) BackfillAvailableData() error {
 
 	log.Print("Initiating the Backfill of Available TMDB Data")
 
+	// Cancel on SIGTERM (Cloud Run Job preemption) so in-flight Publish Results are still
+	// awaited and checkpointed rather than the process being killed mid-export
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
 	// Setup the PubSub Client and Topic ready to publish messages to the given topic
-	ctx := context.Background()
 	psClient, err := pubsub.NewClient(ctx, config.PubSubProjectID)
 	if err != nil {
 		return fmt.Errorf("Create Pub/Sub Client Failed: %w", err)
 	}
 	defer psClient.Close()
 	psTopic := psClient.Topic(config.PubSubTopicID)
+	config.ApplyPublisherConfig(psTopic)
+
+	// Resolve the AVRO Codec, either from a Schema Registry or the embedded Topic Schema
+	var codec *goavro.Codec
+	var schemaID int
+	if config.SchemaRegistryURL != "" {
+		codec, schemaID, err = GetSchemaRegistryCodec(ctx, config.SchemaRegistryURL, config.SchemaRegistrySubject, config.SchemaRegistryVersion)
+		if err != nil {
+			return fmt.Errorf("Failed to Resolve Schema Registry Codec: %w", err)
+		}
+	} else {
+		codec, err = goavro.NewCodec(TMDB_TRIGGER_TOPIC_SCHEMA)
+		if err != nil {
+			return fmt.Errorf("Failed to Create AVRO Codec: %w", err)
+		}
+	}
+	encoder := &avroEncoder{codec: codec, encoding: config.AvroEncoding, schemaID: schemaID}
+
+	// Export Each Type in its own Worker, bounded by MAX_PARALLEL_EXPORT_TYPES
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(config.MaxParallelExportTypes)
+
+	results := make([]ExportResult, len(config.ExportTypes))
+	for i, exportType := range config.ExportTypes {
+		i, exportType := i, exportType
+		group.Go(func() error {
+			result, err := config.exportOneType(groupCtx, psTopic, encoder, exportType)
+			results[i] = result
+			return err
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return fmt.Errorf("Export Worker Failed: %w", err)
+	}
+
+	// Aggregate and Log the Result of Every Export Type Worker
+	var totalBytesRead int64
+	var totalLinesParsed, totalFailureCount int
+	errorClasses := make(map[string]int)
+	for _, result := range results {
+		totalBytesRead += result.BytesRead
+		totalLinesParsed += result.LinesParsed
+		totalFailureCount += result.FailureCount
+		for code, count := range result.ErrorCodeCounts {
+			errorClasses[code] += count
+		}
+
+		log.Printf("Export Type: %s", result.ExportType)
+		log.Printf("....Bytes Read: %d, Lines Parsed: %d", result.BytesRead, result.LinesParsed)
+		log.Printf("....Number of Message(s) Published: %d", result.MessageCount)
+		log.Printf("....Number of Message(s) Failed to Publish: %d", result.FailureCount)
+	}
+
+	log.Printf(
+		"Completed the Backfill of Available TMDB Data: Bytes Read: %d, Lines Parsed: %d, Failures: %d, Error Classes: %v",
+		totalBytesRead, totalLinesParsed, totalFailureCount, errorClasses,
+	)
+
+	return nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// ExportResult is the outcome of a single Export Type Worker, aggregated into the final
+// Backfill summary log line rather than just the previous two counters
+type ExportResult struct {
+	ExportType  string
+	BytesRead   int64
+	LinesParsed int
+	PublishSummary
+}
+
+//---------------------------------------------------------------------------------------
+
+// checkpointPath returns the path of the given Export Type's Checkpoint/Offset file
+func (config *JobConfig) checkpointPath(exportType string) string {
+	return filepath.Join(config.OutputPath, fmt.Sprintf("%s.offset", exportType))
+}
 
-	// Setup the AVRO Codec for the creation of the Pub/Sub Messages
-	codec, err := goavro.NewCodec(TMDB_TRIGGER_TOPIC_SCHEMA)
+// readCheckpoint returns the last successfully-published line number for the given Export
+// Type, or 0 when there is no Checkpoint or this is not a retried Task Attempt
+func (config *JobConfig) readCheckpoint(exportType string) int {
+
+	if config.AttemptNum == "" || config.AttemptNum == "0" {
+		return 0
+	}
+
+	data, err := os.ReadFile(config.checkpointPath(exportType))
 	if err != nil {
-		return fmt.Errorf("Failed to Create AVRO Codec: %w", err)
+		return 0
 	}
 
-	// Iterate through All of the Export Types
-	for _, exportType := range config.ExportTypes {
+	offset, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
 
-		log.Printf("Exporting: %s", exportType)
+	return offset
+}
 
-		// Make the Export API Request
-		var response bytes.Buffer
-		err := requests.
-			URL("http://files.tmdb.org").
-			Pathf("/p/exports/%s.gz", fmt.Sprintf("%s_ids_%s.json", exportType, config.ExportDate.Format("01_02_2006"))).
-			Bearer(config.APIKey).
-			ToBytesBuffer(&response).
-			Fetch(context.Background())
-		if err != nil {
-			return fmt.Errorf("TMDB Movie API Request Failed: %w", err)
-		}
+// writeCheckpoint records the last successfully-published line number for the given Export Type
+func (config *JobConfig) writeCheckpoint(exportType string, line int) error {
+	return os.WriteFile(config.checkpointPath(exportType), []byte(strconv.Itoa(line)), 0600)
+}
 
-		// Decompress the response data
-		gz, err := gzip.NewReader(&response)
-		if err != nil {
-			return fmt.Errorf("GZIP Decompress Failed: %w", err)
-		}
+//---------------------------------------------------------------------------------------
 
-		data, err := io.ReadAll(gz)
-		if err != nil {
-			return fmt.Errorf("Reading Response Body Failed: %w", err)
-		}
+// countingReader wraps an io.Reader, tracking the number of bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
 
-		exportFile, _ := filepath.Abs(filepath.Join(config.OutputPath, fmt.Sprintf("%s.json", exportType)))
-		err = os.WriteFile(exportFile, data, 0600)
-		if err != nil {
-			return fmt.Errorf("Writing Response to File Failed: %w", err)
-		}
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
 
-		// Reset counters
-		messageCount := 0
-		failureCount := 0
+//---------------------------------------------------------------------------------------
 
-		// Iterate through the backfilled data and publish to Pub/Sub
-		var psResults []*pubsub.PublishResult
-		scanner := bufio.NewScanner(strings.NewReader(string(data)))
-		for scanner.Scan() {
+// exportOneType streams, decompresses and publishes a single Export Type's daily TMDB ID
+// export, resuming from its Checkpoint on a retried Task Attempt
+func (config *JobConfig) exportOneType(ctx context.Context, psTopic *pubsub.Topic, encoder *avroEncoder, exportType string) (ExportResult, error) {
 
-			// Unmarshal the JSON into a Map
-			var row map[string]interface{}
-			err = json.Unmarshal(scanner.Bytes(), &row)
-			if err != nil {
-				failureCount++
-				continue
-			}
+	result := ExportResult{ExportType: exportType}
 
-			// Create the Datum Record
-			var datumRecord map[string]interface{} = make(map[string]interface{})
-			datumRecord["id"] = row["id"]
-			datumRecord["type"] = exportType
-			datumRecord["export_date"] = config.ExportDate.Format("2006-01-02")
+	log.Printf("Exporting: %s", exportType)
+	resumeFrom := config.readCheckpoint(exportType)
+	if resumeFrom > 0 {
+		log.Printf("....Resuming %s from Line %d", exportType, resumeFrom)
+	}
 
-			// Convert Datum Record using AVRO Schema to AVRO JSON format
-			msg, err := codec.TextualFromNative(nil, datumRecord)
-			if err != nil {
-				return fmt.Errorf("Failed to create AVRO JSON message: %w", err)
-			}
+	exportFile, _ := filepath.Abs(filepath.Join(config.OutputPath, fmt.Sprintf("%s.json", exportType)))
+	file, err := os.Create(exportFile)
+	if err != nil {
+		return result, fmt.Errorf("Creating Export File Failed: %w", err)
+	}
+	defer file.Close()
+
+	// Lines are fanned out to a bounded channel of Publisher Goroutines so Pub/Sub's own
+	// batching is actually exercised, rather than published one at a time
+	type lineJob struct {
+		lineNum int
+		msg     *pubsub.Message
+	}
+
+	var lineResults []lineResult
+	var resultsMu sync.Mutex
+	unmarshalFailureCount := 0
 
-			// Publish the messages and store the results for later processing
-			psResults = append(psResults, psTopic.Publish(ctx, &pubsub.Message{Data: msg}))
+	publish := func(job lineJob) {
+		psResult := psTopic.Publish(ctx, job.msg)
+		resultsMu.Lock()
+		lineResults = append(lineResults, lineResult{lineNum: job.lineNum, result: psResult, orderingKey: job.msg.OrderingKey})
+		resultsMu.Unlock()
+	}
+
+	var workerGroup sync.WaitGroup
+
+	// Pub/Sub only preserves order within a single Topic's Publish call order, so with
+	// Message Ordering enabled every Message for a given Ordering Key must be published
+	// from the one goroutine. Shard the Workers by Ordering Key instead of fanning every
+	// line out to whichever Worker is free
+	orderedPublish := config.Publisher.OrderingKeyField != ""
+	numWorkers := config.Publisher.NumGoroutines
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
 
-			messageCount++
+	var jobs chan lineJob
+	var shardJobs []chan lineJob
+
+	if orderedPublish {
+		shardJobs = make([]chan lineJob, numWorkers)
+		for i := range shardJobs {
+			shardJobs[i] = make(chan lineJob, config.Publisher.BatchMaxMessages)
+			shard := shardJobs[i]
+			workerGroup.Add(1)
+			go func() {
+				defer workerGroup.Done()
+				for job := range shard {
+					publish(job)
+				}
+			}()
+		}
+	} else {
+		jobs = make(chan lineJob, config.Publisher.BatchMaxMessages)
+		for w := 0; w < numWorkers; w++ {
+			workerGroup.Add(1)
+			go func() {
+				defer workerGroup.Done()
+				for job := range jobs {
+					publish(job)
+				}
+			}()
 		}
+	}
 
-		// Check the Publish Results and count and report any failures
-		for _, result := range psResults {
-			_, err = result.Get(ctx)
+	// dispatch routes a line to whichever Worker may publish it: any free Worker when
+	// order doesn't matter, or the one Worker that owns this line's Ordering Key when it does
+	dispatch := func(job lineJob) {
+		if orderedPublish {
+			shardJobs[orderingKeyShard(job.msg.OrderingKey, len(shardJobs))] <- job
+			return
+		}
+		jobs <- job
+	}
+
+	fetchErr := requests.
+		URL("http://files.tmdb.org").
+		Pathf("/p/exports/%s.gz", fmt.Sprintf("%s_ids_%s.json", exportType, config.ExportDate.Format("01_02_2006"))).
+		Bearer(config.APIKey).
+		AddValidator(nil).
+		Handle(func(res *http.Response) error {
+
+			counting := &countingReader{r: res.Body}
+			gz, err := gzip.NewReader(counting)
 			if err != nil {
-				failureCount++
+				return fmt.Errorf("GZIP Decompress Failed: %w", err)
 			}
-		}
+			defer gz.Close()
+
+			// Scan the decompressed stream line by line, writing it to the Export File as it
+			// is read rather than buffering the whole (sometimes hundreds-of-MB) file in RAM
+			scanner := bufio.NewScanner(io.TeeReader(gz, file))
+			scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+			lineNum := 0
+			for scanner.Scan() {
+				lineNum++
+				if lineNum <= resumeFrom {
+					continue
+				}
+
+				var row map[string]interface{}
+				if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+					unmarshalFailureCount++
+					continue
+				}
+
+				datumRecord := map[string]interface{}{
+					"id":          row["id"],
+					"type":        exportType,
+					"export_date": config.ExportDate.Format("2006-01-02"),
+				}
+
+				msg, attrs, err := encoder.Encode(datumRecord)
+				if err != nil {
+					return fmt.Errorf("Failed to create AVRO message: %w", err)
+				}
+
+				psMsg := &pubsub.Message{Data: msg, Attributes: attrs}
+				if config.Publisher.OrderingKeyField != "" {
+					psMsg.OrderingKey = orderingKeyFromRecord(config.Publisher.OrderingKeyField, datumRecord)
+				}
+
+				dispatch(lineJob{lineNum: lineNum, msg: psMsg})
+				result.LinesParsed++
+			}
+			result.BytesRead = counting.n
 
-		log.Printf("Export Type: %s", exportType)
-		log.Printf("....Number of Message(s) Published: %d", messageCount)
-		log.Printf("....Number of Message(s) Failed to Publish: %d", failureCount)
+			return scanner.Err()
+		}).
+		Fetch(ctx)
+
+	if orderedPublish {
+		for _, shard := range shardJobs {
+			close(shard)
+		}
+	} else {
+		close(jobs)
 	}
+	workerGroup.Wait()
 
-	log.Print("Completed the Backfill of Available TMDB Data")
+	// Await and checkpoint whatever was already published even when the fetch itself failed
+	// partway through or was cancelled, so an interrupted Attempt resumes ahead rather than
+	// from scratch; the wait is therefore not bound to the export's own context
+	summary := config.AwaitPublishResults(context.Background(), psTopic, exportType, resumeFrom, lineResults, numWorkers)
+	summary.FailureCount += unmarshalFailureCount
+	result.PublishSummary = summary
 
-	return nil
+	if fetchErr != nil {
+		return result, fmt.Errorf("TMDB Export Request Failed: %w", fetchErr)
+	}
+
+	return result, nil
 }
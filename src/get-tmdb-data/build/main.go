@@ -17,13 +17,18 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/pubsub"
@@ -31,17 +36,44 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/linkedin/goavro"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/status"
 )
 
 // Cloud Run Service Configuration
 type ServiceConfig struct {
-	Port              int
-	TimeoutSeconds    time.Duration
-	APIKey            string
-	APIEndpointList   map[string]map[string]string
-	PubSubProjectID   string
-	PubSubTopicID     string
-	PubSubTopicSchema string
+	Port                  int
+	TimeoutSeconds        time.Duration
+	APIKey                string
+	APIEndpointList       map[string]map[string]string
+	PubSubProjectID       string
+	PubSubTopicID         string
+	PubSubTopicSchema     string
+	Publisher             PublisherConfig
+	TMDB                  *tmdbClient
+	AvroEncoding          AvroEncoding
+	SchemaRegistryURL     string
+	SchemaRegistrySubject string
+	SchemaRegistryVersion string
+	PubSubClient          *pubsub.Client
+	PubSubTopic           *pubsub.Topic
+	AvroCodec             *goavro.Codec
+	SchemaID              int
+}
+
+// Pub/Sub Publisher Configuration, applied to every Topic's PublishSettings
+type PublisherConfig struct {
+	MaxOutstandingMessages int
+	MaxOutstandingBytes    int
+	BatchMaxMessages       int
+	BatchMaxBytes          int
+	BatchDelay             time.Duration
+	NumGoroutines          int
+	OrderingKeyField       string
 }
 
 //---------------------------------------------------------------------------------------
@@ -71,6 +103,9 @@ func main() {
 	{
 		apiv1.POST("/export", config.v1Export)
 	}
+	router.GET("/healthz", Healthz)
+	router.GET("/readyz", config.Readyz)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// Start listening and serve the API responses
 	s := &http.Server{
@@ -146,16 +181,579 @@ func NewServiceConfig() ServiceConfig {
 		os.Exit(int(ERROR))
 	}
 
-	return ServiceConfig{
-		Port:              port,
-		TimeoutSeconds:    time.Duration(timeout) * time.Second,
-		APIKey:            os.Getenv("API_KEY"),
-		APIEndpointList:   apiEndpointList,
-		PubSubProjectID:   os.Getenv("PUBSUB_PROJECT_ID"),
-		PubSubTopicID:     os.Getenv("PUBSUB_TOPIC_ID"),
-		PubSubTopicSchema: os.Getenv("PUBSUB_TOPIC_SCHEMA"),
+	config := ServiceConfig{
+		Port:                  port,
+		TimeoutSeconds:        time.Duration(timeout) * time.Second,
+		APIKey:                os.Getenv("API_KEY"),
+		APIEndpointList:       apiEndpointList,
+		PubSubProjectID:       os.Getenv("PUBSUB_PROJECT_ID"),
+		PubSubTopicID:         os.Getenv("PUBSUB_TOPIC_ID"),
+		PubSubTopicSchema:     os.Getenv("PUBSUB_TOPIC_SCHEMA"),
+		Publisher:             NewPublisherConfig(),
+		TMDB:                  newTMDBClient(os.Getenv("API_KEY")),
+		AvroEncoding:          ParseAvroEncoding(os.Getenv("AVRO_ENCODING")),
+		SchemaRegistryURL:     os.Getenv("SCHEMA_REGISTRY_URL"),
+		SchemaRegistrySubject: os.Getenv("SCHEMA_REGISTRY_SUBJECT"),
+		SchemaRegistryVersion: defaultString(os.Getenv("SCHEMA_REGISTRY_VERSION"), "latest"),
 	}
 
+	// Construct the Pub/Sub Client, Topic and AVRO Codec once at startup so a bad
+	// configuration fails fast here rather than on the first request
+	ctx := context.Background()
+	psClient, err := pubsub.NewClient(ctx, config.PubSubProjectID)
+	if err != nil {
+		msg := fmt.Sprintf("Create Pub/Sub Client Failed: %v", err)
+		PrintLogEntry(ERROR, msg)
+		os.Exit(int(ERROR))
+	}
+	psTopic := psClient.Topic(config.PubSubTopicID)
+	config.ApplyPublisherConfig(psTopic)
+	config.PubSubClient = psClient
+	config.PubSubTopic = psTopic
+
+	// Resolve the AVRO Codec, either from a Schema Registry or the static Topic Schema
+	if config.SchemaRegistryURL != "" {
+		codec, schemaID, err := GetSchemaRegistryCodec(ctx, config.SchemaRegistryURL, config.SchemaRegistrySubject, config.SchemaRegistryVersion)
+		if err != nil {
+			msg := fmt.Sprintf("Failed to Resolve Schema Registry Codec: %v", err)
+			PrintLogEntry(ERROR, msg)
+			os.Exit(int(ERROR))
+		}
+		config.AvroCodec = codec
+		config.SchemaID = schemaID
+	} else {
+		// Decode the Topic Schema which is passed through as Base64
+		rawSchema, err := base64.StdEncoding.DecodeString(config.PubSubTopicSchema)
+		if err != nil {
+			msg := fmt.Sprintf("Failed to Decode Topic Schema Base64 String: %v", err)
+			PrintLogEntry(ERROR, msg)
+			os.Exit(int(ERROR))
+		}
+
+		codec, err := goavro.NewCodec(string(rawSchema))
+		if err != nil {
+			msg := fmt.Sprintf("Failed to Create AVRO Codec: %v", err)
+			PrintLogEntry(ERROR, msg)
+			os.Exit(int(ERROR))
+		}
+		config.AvroCodec = codec
+	}
+
+	return config
+
+}
+
+//---------------------------------------------------------------------------------------
+
+// Get the given String, falling back to the provided default when empty
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+//---------------------------------------------------------------------------------------
+
+// Get a New Publisher Configuration from Environment Variables, falling back to the
+// Pub/Sub client library defaults when a given variable is not set
+func NewPublisherConfig() PublisherConfig {
+
+	return PublisherConfig{
+		MaxOutstandingMessages: getEnvInt("PUBSUB_MAX_OUTSTANDING_MESSAGES", 1000),
+		MaxOutstandingBytes:    getEnvInt("PUBSUB_MAX_OUTSTANDING_BYTES", 1e9),
+		BatchMaxMessages:       getEnvInt("PUBSUB_BATCH_MAX_MESSAGES", 100),
+		BatchMaxBytes:          getEnvInt("PUBSUB_BATCH_MAX_BYTES", 1e6),
+		BatchDelay:             time.Duration(getEnvInt("PUBSUB_BATCH_DELAY_MS", 10)) * time.Millisecond,
+		NumGoroutines:          getEnvInt("PUBSUB_NUM_GOROUTINES", 25),
+		OrderingKeyField:       os.Getenv("PUBSUB_ORDERING_KEY_FIELD"),
+	}
+
+}
+
+//---------------------------------------------------------------------------------------
+
+// Get an Integer Environment Variable, falling back to the given default when unset or invalid
+func getEnvInt(key string, fallback int) int {
+
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value == 0 {
+		return fallback
+	}
+
+	return value
+}
+
+//---------------------------------------------------------------------------------------
+
+// Get a Float Environment Variable, falling back to the given default when unset or invalid
+func getEnvFloat(key string, fallback float64) float64 {
+
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || value == 0 {
+		return fallback
+	}
+
+	return value
+}
+
+//---------------------------------------------------------------------------------------
+
+// AvroEncoding selects between Pub/Sub's BINARY and JSON AVRO wire encodings
+type AvroEncoding int
+
+const (
+	AvroEncodingBinary AvroEncoding = iota
+	AvroEncodingJSON
+)
+
+// ParseAvroEncoding parses the AVRO_ENCODING environment variable, defaulting to BINARY
+func ParseAvroEncoding(value string) AvroEncoding {
+	if strings.EqualFold(value, "JSON") {
+		return AvroEncodingJSON
+	}
+	return AvroEncodingBinary
+}
+
+//---------------------------------------------------------------------------------------
+
+// SchemaRegistrySchema mirrors a Confluent-compatible /subjects/{name}/versions/{version} response
+type SchemaRegistrySchema struct {
+	ID     int    `json:"id"`
+	Schema string `json:"schema"`
+}
+
+// cachedSchema pairs a resolved AVRO Codec with its Schema Registry ID
+type cachedSchema struct {
+	codec *goavro.Codec
+	id    int
+}
+
+// schemaRegistryCache caches resolved Codecs by "<subject>/<version>" so repeated requests
+// don't refetch the schema from the Registry
+var schemaRegistryCache sync.Map
+
+// GetSchemaRegistryCodec fetches and caches an AVRO Codec by subject+version from a Confluent-
+// compatible Schema Registry
+func GetSchemaRegistryCodec(ctx context.Context, registryURL, subject, version string) (*goavro.Codec, int, error) {
+
+	cacheKey := subject + "/" + version
+	if cached, ok := schemaRegistryCache.Load(cacheKey); ok {
+		schema := cached.(*cachedSchema)
+		return schema.codec, schema.id, nil
+	}
+
+	var schemaResp SchemaRegistrySchema
+	err := requests.
+		URL(registryURL).
+		Pathf("/subjects/%s/versions/%s", subject, version).
+		ToJSON(&schemaResp).
+		Fetch(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to Fetch Schema from Registry: %w", err)
+	}
+
+	codec, err := goavro.NewCodec(schemaResp.Schema)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to Create AVRO Codec from Registry Schema: %w", err)
+	}
+
+	schemaRegistryCache.Store(cacheKey, &cachedSchema{codec: codec, id: schemaResp.ID})
+
+	return codec, schemaResp.ID, nil
+}
+
+//---------------------------------------------------------------------------------------
+
+// avroEncoder produces Pub/Sub message payloads per the configured AvroEncoding, applying
+// Confluent-compatible magic-byte + schema-ID framing when the Codec came from a Schema Registry
+type avroEncoder struct {
+	codec    *goavro.Codec
+	encoding AvroEncoding
+	schemaID int
+}
+
+// Encode converts the given datum record into a Pub/Sub message payload and the Attributes
+// Pub/Sub's native Schema Registry integration expects
+func (e *avroEncoder) Encode(datum map[string]interface{}) ([]byte, map[string]string, error) {
+
+	start := time.Now()
+	defer func() { avroEncodeDuration.Observe(time.Since(start).Seconds()) }()
+
+	if e.encoding == AvroEncodingJSON {
+		payload, err := e.codec.TextualFromNative(nil, datum)
+		if err != nil {
+			return nil, nil, err
+		}
+		return payload, map[string]string{"googclient_schemaencoding": "JSON"}, nil
+	}
+
+	payload, err := e.codec.BinaryFromNative(nil, datum)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attrs := map[string]string{"googclient_schemaencoding": "BINARY"}
+	if e.schemaID != 0 {
+		payload = append(confluentMagicByteFraming(e.schemaID), payload...)
+		attrs["googclient_schemarevisionid"] = strconv.Itoa(e.schemaID)
+	}
+
+	return payload, attrs, nil
+}
+
+// confluentMagicByteFraming builds the 5-byte magic-byte + big-endian schema-ID prefix that
+// Confluent-compatible consumers (Kafka Connect, BigQuery subscriptions) expect ahead of a
+// binary AVRO payload
+func confluentMagicByteFraming(schemaID int) []byte {
+	framing := make([]byte, 5)
+	binary.BigEndian.PutUint32(framing[1:], uint32(schemaID))
+	return framing
+}
+
+//---------------------------------------------------------------------------------------
+
+// Apply the Publisher Configuration to the given Pub/Sub Topic
+func (config *ServiceConfig) ApplyPublisherConfig(psTopic *pubsub.Topic) {
+
+	psTopic.PublishSettings = pubsub.PublishSettings{
+		DelayThreshold: config.Publisher.BatchDelay,
+		CountThreshold: config.Publisher.BatchMaxMessages,
+		ByteThreshold:  config.Publisher.BatchMaxBytes,
+		NumGoroutines:  config.Publisher.NumGoroutines,
+		FlowControlSettings: pubsub.FlowControlSettings{
+			MaxOutstandingMessages: config.Publisher.MaxOutstandingMessages,
+			MaxOutstandingBytes:    config.Publisher.MaxOutstandingBytes,
+			LimitExceededBehavior:  pubsub.FlowControlBlock,
+		},
+	}
+
+	if config.Publisher.OrderingKeyField != "" {
+		psTopic.EnableMessageOrdering = true
+	}
+
+}
+
+// orderingKeyFromRecord extracts the configured Ordering Key Field's value from the Datum
+// Record as a string, returning "" (no ordering key) when the field is absent or empty
+func orderingKeyFromRecord(field string, record map[string]interface{}) string {
+	value, ok := record[field]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+//---------------------------------------------------------------------------------------
+
+// Prometheus Metrics, registered on the default registry and served from GET /metrics
+var (
+	tmdbRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tmdb_requests_total",
+		Help: "Count of TMDB API requests by export type, response type and HTTP status code.",
+	}, []string{"type", "resp_type", "code"})
+
+	tmdbRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tmdb_request_duration_seconds",
+		Help:    "Latency of TMDB API requests in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"type", "resp_type"})
+
+	pubsubPublishTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pubsub_publish_total",
+		Help: "Count of Pub/Sub publish results by outcome.",
+	}, []string{"result"})
+
+	pubsubPublishDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pubsub_publish_duration_seconds",
+		Help:    "Time spent awaiting Pub/Sub publish results in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	avroEncodeDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "avro_encode_duration_seconds",
+		Help:    "Time spent encoding a Datum Record to its AVRO wire payload in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+//---------------------------------------------------------------------------------------
+
+// Healthz reports process liveness
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports readiness, which depends on the Pub/Sub Topic and AVRO Codec having
+// been constructed successfully in NewServiceConfig
+func (config *ServiceConfig) Readyz(c *gin.Context) {
+	if config.PubSubTopic == nil || config.AvroCodec == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not ready"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+//---------------------------------------------------------------------------------------
+
+// Publish Summary reported in place of the previous Sprintf'd one line summary
+type PublishSummary struct {
+	RequestCount    int            `json:"request_count"`
+	MessageCount    int            `json:"message_count"`
+	FailureCount    int            `json:"failure_count"`
+	ErrorCodeCounts map[string]int `json:"error_code_counts,omitempty"`
+}
+
+//---------------------------------------------------------------------------------------
+
+// publishedMessage pairs a Publish Result with the Ordering Key (if any) of the Message it
+// came from, so a failure can resume that key rather than wedging subsequent Publish calls
+type publishedMessage struct {
+	result      *pubsub.PublishResult
+	orderingKey string
+}
+
+// Await the given Pub/Sub Publish Results concurrently, bounded by the configured number
+// of goroutines, aggregating failures by their gRPC status code. When Message Ordering is
+// enabled, a failed Publish pauses its Ordering Key until ResumePublish is called, so every
+// failure resumes the key it belongs to
+func AwaitPublishResults(ctx context.Context, psTopic *pubsub.Topic, published []publishedMessage, concurrency int) PublishSummary {
+
+	start := time.Now()
+	defer func() { pubsubPublishDuration.Observe(time.Since(start).Seconds()) }()
+
+	var summary = PublishSummary{MessageCount: len(published)}
+	var mu sync.Mutex
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(concurrency)
+
+	for _, p := range published {
+		p := p
+		group.Go(func() error {
+			_, err := p.result.Get(groupCtx)
+			if err != nil {
+				if p.orderingKey != "" {
+					psTopic.ResumePublish(p.orderingKey)
+				}
+				mu.Lock()
+				summary.FailureCount++
+				if summary.ErrorCodeCounts == nil {
+					summary.ErrorCodeCounts = make(map[string]int)
+				}
+				summary.ErrorCodeCounts[status.Code(err).String()]++
+				mu.Unlock()
+				pubsubPublishTotal.WithLabelValues("failure").Inc()
+			} else {
+				pubsubPublishTotal.WithLabelValues("success").Inc()
+			}
+			return nil
+		})
+	}
+
+	// Errors are aggregated above rather than propagated, so this can never fail
+	_ = group.Wait()
+
+	return summary
+}
+
+//---------------------------------------------------------------------------------------
+
+// Circuit Breaker Tuning, hardcoded rather than env driven as this is an internal
+// safety valve rather than something operators need to tune per environment
+const (
+	circuitBreakerFailureThreshold = 5
+	circuitBreakerCooldown         = 30 * time.Second
+)
+
+// errCircuitOpen is returned by tmdbClient.Fetch while the Circuit Breaker is open
+var errCircuitOpen = errors.New("tmdb api circuit breaker open, refusing to call")
+
+// Tracks consecutive TMDB API failures and opens the Circuit once the threshold is
+// reached, closing it again after the cooldown has elapsed
+type circuitBreaker struct {
+	mu            sync.Mutex
+	failures      int
+	failureThresh int
+	cooldown      time.Duration
+	openedAt      time.Time
+}
+
+// Construct a new Circuit Breaker with the given failure threshold and cooldown
+func newCircuitBreaker(failureThreshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{failureThresh: failureThreshold, cooldown: cooldown}
+}
+
+// Allow reports whether a call should be attempted
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.failureThresh {
+		return true
+	}
+	if time.Since(b.openedAt) > b.cooldown {
+		b.failures = 0
+		return true
+	}
+
+	return false
+}
+
+// RecordSuccess resets the failure count, closing the Circuit
+func (b *circuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+// RecordFailure increments the failure count, opening the Circuit once the threshold is reached
+func (b *circuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.failures == b.failureThresh {
+		b.openedAt = time.Now()
+	}
+}
+
+//---------------------------------------------------------------------------------------
+
+// tmdbHTTPError captures a non-2xx TMDB API response, including the Retry-After delay
+// requested by a 429 response
+type tmdbHTTPError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *tmdbHTTPError) Error() string {
+	return fmt.Sprintf("tmdb api responded with status %d", e.StatusCode)
+}
+
+// retryable reports whether the given error warrants another attempt
+func (e *tmdbHTTPError) retryable() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+//---------------------------------------------------------------------------------------
+
+// tmdbClient wraps carlmjohnson/requests with rate limiting, retry with backoff, and a
+// Circuit Breaker so a run of transient TMDB failures degrades gracefully instead of
+// aborting the whole export
+type tmdbClient struct {
+	apiKey     string
+	limiter    *rate.Limiter
+	maxRetries int
+	breaker    *circuitBreaker
+}
+
+// Construct a new TMDB API Client from Environment Variables
+func newTMDBClient(apiKey string) *tmdbClient {
+
+	rps := getEnvFloat("TMDB_RPS", 4)
+	burst := getEnvInt("TMDB_BURST", 10)
+	maxRetries := getEnvInt("TMDB_MAX_RETRIES", 3)
+
+	return &tmdbClient{
+		apiKey:     apiKey,
+		limiter:    rate.NewLimiter(rate.Limit(rps), burst),
+		maxRetries: maxRetries,
+		breaker:    newCircuitBreaker(circuitBreakerFailureThreshold, circuitBreakerCooldown),
+	}
+}
+
+// Fetch the given URL, rate limited, retried on 5xx/network errors and 429s with
+// exponential backoff plus jitter, and short-circuited while the Circuit Breaker is open.
+// Returns the final HTTP status code alongside the response body so callers can label
+// metrics and logs with it; the status code is 0 when the final attempt received no HTTP
+// response
+func (t *tmdbClient) Fetch(ctx context.Context, url string) (string, int, error) {
+
+	if !t.breaker.Allow() {
+		return "", 0, errCircuitOpen
+	}
+
+	var lastErr error
+	var lastStatus int
+	for attempt := 0; attempt <= t.maxRetries; attempt++ {
+
+		if attempt > 0 {
+			delay := backoffWithJitter(attempt)
+			var httpErr *tmdbHTTPError
+			if errors.As(lastErr, &httpErr) && httpErr.RetryAfter > 0 {
+				delay = httpErr.RetryAfter
+			}
+			select {
+			case <-ctx.Done():
+				return "", lastStatus, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		if err := t.limiter.Wait(ctx); err != nil {
+			return "", lastStatus, err
+		}
+
+		var response string
+		var status int
+		err := requests.
+			URL(url).
+			Bearer(t.apiKey).
+			AddValidator(nil).
+			Handle(func(res *http.Response) error {
+				status = res.StatusCode
+				if res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests {
+					return &tmdbHTTPError{StatusCode: res.StatusCode, RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"))}
+				}
+				if res.StatusCode < 200 || res.StatusCode >= 300 {
+					return &tmdbHTTPError{StatusCode: res.StatusCode}
+				}
+				body, readErr := io.ReadAll(res.Body)
+				response = string(body)
+				return readErr
+			}).
+			Fetch(ctx)
+
+		lastStatus = status
+		if err == nil {
+			t.breaker.RecordSuccess()
+			return response, lastStatus, nil
+		}
+
+		lastErr = err
+		var httpErr *tmdbHTTPError
+		if errors.As(err, &httpErr) && !httpErr.retryable() {
+			// A non-retryable 4xx (bad/retired id, auth, ...) means TMDB is healthy and
+			// answered definitively, so it must not count as a Circuit Breaker failure
+			return "", lastStatus, err
+		}
+	}
+
+	t.breaker.RecordFailure()
+	return "", lastStatus, fmt.Errorf("tmdb api request failed after %d attempt(s): %w", t.maxRetries+1, lastErr)
+}
+
+// backoffWithJitter returns an exponential backoff duration with full jitter for the given attempt
+func backoffWithJitter(attempt int) time.Duration {
+	base := 200 * time.Millisecond * time.Duration(1<<uint(attempt-1))
+	return time.Duration(rand.Int63n(int64(base)))
+}
+
+// parseRetryAfter parses a Retry-After header expressed as either delay-seconds or an HTTP-date
+func parseRetryAfter(header string) time.Duration {
+
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		return time.Until(when)
+	}
+
+	return 0
 }
 
 //---------------------------------------------------------------------------------------
@@ -210,54 +808,37 @@ func (config *ServiceConfig) v1Export(c *gin.Context) {
 		return
 	}
 
-	// Setup the PubSub Client and Topic ready to publish messages to the given topic
 	ctx := context.Background()
-	psClient, err := pubsub.NewClient(ctx, config.PubSubProjectID)
-	if err != nil {
-		msg := fmt.Sprintf("Create Pub/Sub Client Failed: %v", err)
-		PrintLogEntry(DEBUG, msg)
-		AbortWithError(c, http.StatusBadRequest, msg)
-		return
-	}
-	defer psClient.Close()
-	psTopic := psClient.Topic(config.PubSubTopicID)
-
-	// Decode the Topic Schema which is passed through as Base64
-	rawSchema, err := base64.StdEncoding.DecodeString(config.PubSubTopicSchema)
-	if err != nil {
-		msg := fmt.Sprintf("Failed to Decode Topic Schema Base64 String: %v", err)
-		PrintLogEntry(DEBUG, msg)
-		AbortWithError(c, http.StatusBadRequest, msg)
-		return
-	}
-
-	// Setup the AVRO Codec for the creation of the Pub/Sub Messages
-	codec, err := goavro.NewCodec(string(rawSchema))
-	if err != nil {
-		msg := fmt.Sprintf("Failed to Create AVRO Codec: %v", err)
-		PrintLogEntry(DEBUG, msg)
-		AbortWithError(c, http.StatusBadRequest, msg)
-		return
-	}
+	encoder := &avroEncoder{codec: config.AvroCodec, encoding: config.AvroEncoding, schemaID: config.SchemaID}
 
 	// Iterate through the API Endpoint List and Fetch Data
 	var requestCount int = 0
-	var avroMessages [][]byte
+	var encodedMessages []*pubsub.Message
 	for respType, endpoint := range list {
 		url := strings.ReplaceAll(endpoint, "{id}", strconv.Itoa(request.ID))
 
-		// Make the API Request
-		var response string
-		err := requests.
-			URL(url).
-			Bearer(config.APIKey).
-			AddValidator(nil).
-			ToString(&response).
-			Fetch(context.Background())
+		// Make the API Request, rate limited, retried and circuit broken
+		fetchStart := time.Now()
+		response, statusCode, err := config.TMDB.Fetch(c.Request.Context(), url)
+		tmdbRequestDuration.WithLabelValues(request.Type, respType).Observe(time.Since(fetchStart).Seconds())
+		tmdbRequestsTotal.WithLabelValues(request.Type, respType, strconv.Itoa(statusCode)).Inc()
 		if err != nil {
 			msg := fmt.Sprintf("API Request Failed: %v", err)
 			PrintLogEntry(DEBUG, msg)
-			AbortWithError(c, http.StatusBadRequest, msg)
+
+			// A non-retryable 4xx (bad/retired id, auth, ...) is permanent, and Pub/Sub
+			// push redelivers on any non-2xx response regardless of status code, so the
+			// only way to actually drop it rather than redeliver forever is to ack it
+			var httpErr *tmdbHTTPError
+			if errors.As(err, &httpErr) && !httpErr.retryable() {
+				PrintLogEntry(INFO, fmt.Sprintf("Acking and Dropping Permanently-Failed ExportRequest: %v", msg))
+				c.JSON(http.StatusOK, gin.H{"id": request.ID, "type": request.Type, "dropped": msg})
+				return
+			}
+
+			// Returning 503 on a retriable failure has Pub/Sub redeliver the push later
+			// instead of Cloud Run holding the connection open
+			AbortWithError(c, http.StatusServiceUnavailable, msg)
 			return
 		}
 
@@ -280,37 +861,38 @@ func (config *ServiceConfig) v1Export(c *gin.Context) {
 			return
 		}
 
-		// Convert ExportResponse using AVRO Schema to AVRO JSON format
-		avroMessage, err := codec.TextualFromNative(nil, datumRecord)
+		// Convert ExportResponse using AVRO Schema to the configured wire encoding
+		avroMessage, attrs, err := encoder.Encode(datumRecord)
 		if err != nil {
-			msg := fmt.Sprintf("Failed to create ExportResponse AVRO JSON message: %v", err)
+			msg := fmt.Sprintf("Failed to create ExportResponse AVRO message: %v", err)
 			PrintLogEntry(DEBUG, msg)
 			AbortWithError(c, http.StatusBadRequest, msg)
 			return
 		}
 
-		avroMessages = append(avroMessages, avroMessage)
+		psMsg := &pubsub.Message{Data: avroMessage, Attributes: attrs}
+		if config.Publisher.OrderingKeyField != "" {
+			psMsg.OrderingKey = orderingKeyFromRecord(config.Publisher.OrderingKeyField, datumRecord)
+		}
+		encodedMessages = append(encodedMessages, psMsg)
 		requestCount++
 	}
 
 	// Iterate through the API Response and Publish to the Pub/Sub Topic
-	var messageCount int = 0
-	var psResults []*pubsub.PublishResult
-	for _, avroMessage := range avroMessages {
+	var published []publishedMessage
+	for _, encodedMessage := range encodedMessages {
 		// Publish the messages and store the results for later processing
-		psResults = append(psResults, psTopic.Publish(ctx, &pubsub.Message{Data: avroMessage}))
-		messageCount++
+		published = append(published, publishedMessage{
+			result:      config.PubSubTopic.Publish(ctx, encodedMessage),
+			orderingKey: encodedMessage.OrderingKey,
+		})
 	}
 
-	// Check the Publish Results and count and report any failures
-	var failureCount int = 0
-	for _, result := range psResults {
-		_, err = result.Get(ctx)
-		if err != nil {
-			failureCount++
-		}
-	}
+	// Await the Publish Results concurrently, bounded by the configured goroutine limit,
+	// and aggregate any failures by their gRPC status code
+	summary := AwaitPublishResults(ctx, config.PubSubTopic, published, config.Publisher.NumGoroutines)
+	summary.RequestCount = requestCount
 
-	c.JSON(http.StatusOK, fmt.Sprintf("API Requests: %d, Messages Sent: %d, Failed Messages: %d", requestCount, messageCount, failureCount))
+	c.JSON(http.StatusOK, summary)
 
 }